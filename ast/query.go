@@ -0,0 +1,36 @@
+package ast
+
+// Note: this package snapshot does not include anko's parser, so nothing
+// here yet lowers `coll | where(...)`/`group_by(...)`/`sort_by(...)`
+// syntax into the node types below - they're only reachable by
+// constructing them directly. The vm package evaluates them regardless,
+// so wiring the parser's pipe-operator handling to emit these nodes is
+// the only piece missing for the surface syntax to work end to end.
+
+// WhereExpr filters Coll to the elements whose dotted Key path satisfies
+// Op against Val, e.g. `coll | where("k.sub", "==", 3)`. It is modeled
+// after Hugo's `where` template function.
+type WhereExpr struct {
+	ExprImpl
+	Coll Expr
+	Key  string
+	Op   string
+	Val  Expr
+}
+
+// GroupByExpr groups the elements of Coll by their dotted Key path into a
+// map[string][]interface{}, e.g. `coll | group_by("type")`.
+type GroupByExpr struct {
+	ExprImpl
+	Coll Expr
+	Key  string
+}
+
+// SortByExpr sorts the elements of Coll by their dotted Key path,
+// ascending unless Desc is set, e.g. `coll | sort_by("name")`.
+type SortByExpr struct {
+	ExprImpl
+	Coll Expr
+	Key  string
+	Desc bool
+}
@@ -0,0 +1,117 @@
+package vm
+
+import (
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/mattn/anko/ast"
+)
+
+// evalBinOp performs the operator dispatch for an already-evaluated
+// BinOpExpr's operands. It's shared by invokeExpr, invokeExprCtx and the
+// bytecode VM's binOpcode so none of them can drift apart on what a given
+// operator does - in particular so AnkoNumber arithmetic is handled
+// identically by all three.
+func evalBinOp(expr ast.Expr, operator string, lhsV, rhsV reflect.Value) (reflect.Value, error) {
+	// When both operands are still exact literals/results of prior exact
+	// arithmetic, stay in go/constant rather than collapsing to
+	// int64/float64 - this is what lets "2 ** 100" and "1e100 / 3" come
+	// out correct instead of overflowing/losing precision.
+	if lhsN, ok := asAnkoNumber(lhsV); ok {
+		if rhsN, ok := asAnkoNumber(rhsV); ok {
+			if isArbitraryPrecisionOp(operator) {
+				return evalAnkoNumberOp(operator, lhsN, rhsN)
+			}
+			switch operator {
+			case "==", "!=", "<", "<=", ">", ">=":
+				return compareAnkoNumbers(operator, lhsN, rhsN)
+			}
+		}
+	}
+	if lhsN, ok := asAnkoNumber(lhsV); ok {
+		lhsV = toConcrete(lhsN)
+	}
+	if rhsN, ok := asAnkoNumber(rhsV); ok {
+		rhsV = toConcrete(rhsN)
+	}
+
+	switch operator {
+	case "+":
+		if (lhsV.Kind() == reflect.Slice || lhsV.Kind() == reflect.Array) && (rhsV.Kind() != reflect.Slice && rhsV.Kind() != reflect.Array) {
+			rhsT := rhsV.Type()
+			lhsT := lhsV.Type().Elem()
+			if lhsT.Kind() != rhsT.Kind() {
+				if !rhsT.ConvertibleTo(lhsT) {
+					return NilValue, NewStringError(expr, "invalid type conversion")
+				}
+				rhsV = rhsV.Convert(lhsT)
+			}
+			return reflect.Append(lhsV, rhsV), nil
+		}
+		if (lhsV.Kind() == reflect.Slice || lhsV.Kind() == reflect.Array) && (rhsV.Kind() == reflect.Slice || rhsV.Kind() == reflect.Array) {
+			return appendSlice(expr, lhsV, rhsV)
+		}
+		if lhsV.Kind() == reflect.String || rhsV.Kind() == reflect.String {
+			return reflect.ValueOf(toString(lhsV) + toString(rhsV)), nil
+		}
+		if lhsV.Kind() == reflect.Float64 || rhsV.Kind() == reflect.Float64 {
+			return reflect.ValueOf(toFloat64(lhsV) + toFloat64(rhsV)), nil
+		}
+		return reflect.ValueOf(toInt64(lhsV) + toInt64(rhsV)), nil
+	case "-":
+		if lhsV.Kind() == reflect.Float64 || rhsV.Kind() == reflect.Float64 {
+			return reflect.ValueOf(toFloat64(lhsV) - toFloat64(rhsV)), nil
+		}
+		return reflect.ValueOf(toInt64(lhsV) - toInt64(rhsV)), nil
+	case "*":
+		if lhsV.Kind() == reflect.String && (rhsV.Kind() == reflect.Int || rhsV.Kind() == reflect.Int32 || rhsV.Kind() == reflect.Int64) {
+			return reflect.ValueOf(strings.Repeat(toString(lhsV), int(toInt64(rhsV)))), nil
+		}
+		if lhsV.Kind() == reflect.Float64 || rhsV.Kind() == reflect.Float64 {
+			return reflect.ValueOf(toFloat64(lhsV) * toFloat64(rhsV)), nil
+		}
+		return reflect.ValueOf(toInt64(lhsV) * toInt64(rhsV)), nil
+	case "/":
+		return reflect.ValueOf(toFloat64(lhsV) / toFloat64(rhsV)), nil
+	case "%":
+		return reflect.ValueOf(toInt64(lhsV) % toInt64(rhsV)), nil
+	case "==":
+		return reflect.ValueOf(equal(lhsV, rhsV)), nil
+	case "!=":
+		return reflect.ValueOf(equal(lhsV, rhsV) == false), nil
+	case ">":
+		return reflect.ValueOf(toFloat64(lhsV) > toFloat64(rhsV)), nil
+	case ">=":
+		return reflect.ValueOf(toFloat64(lhsV) >= toFloat64(rhsV)), nil
+	case "<":
+		return reflect.ValueOf(toFloat64(lhsV) < toFloat64(rhsV)), nil
+	case "<=":
+		return reflect.ValueOf(toFloat64(lhsV) <= toFloat64(rhsV)), nil
+	case "|":
+		return reflect.ValueOf(toInt64(lhsV) | toInt64(rhsV)), nil
+	case "||":
+		if toBool(lhsV) {
+			return lhsV, nil
+		}
+		return rhsV, nil
+	case "&":
+		return reflect.ValueOf(toInt64(lhsV) & toInt64(rhsV)), nil
+	case "&&":
+		if toBool(lhsV) {
+			return rhsV, nil
+		}
+		return lhsV, nil
+	case "**":
+		if lhsV.Kind() == reflect.Float64 {
+			return reflect.ValueOf(math.Pow(lhsV.Float(), toFloat64(rhsV))), nil
+		}
+		return reflect.ValueOf(int64(math.Pow(toFloat64(lhsV), toFloat64(rhsV)))), nil
+	case ">>":
+		return reflect.ValueOf(toInt64(lhsV) >> uint64(toInt64(rhsV))), nil
+	case "<<":
+		return reflect.ValueOf(toInt64(lhsV) << uint64(toInt64(rhsV))), nil
+	default:
+		return NilValue, NewStringError(expr, "Unknown operator")
+	}
+}
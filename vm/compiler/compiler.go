@@ -0,0 +1,389 @@
+// Package compiler lowers anko's AST into a flat bytecode Program that
+// vm.Machine can execute directly, without re-walking the tree on every
+// call. It is the first half of the "compile once, run many times" split;
+// vm.Run (in the parent vm package) does the executing.
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mattn/anko/ast"
+)
+
+// Program is the compiled form of a sequence of statements: a flat
+// instruction stream plus the constant pool and the name table
+// OpLoadName/OpStoreName/OpMember index into.
+//
+// Identifiers go through OpLoadName/OpStoreName, which read and write the
+// *vm.Env directly (by name) rather than a slots array private to the
+// Machine - the compiler has no way to prove, without cooperation from
+// Env itself, that a given identifier isn't visible to code outside the
+// compiled program (a closure, a sibling statement run through invokeExpr,
+// a dynamic Env.Define at runtime). Resolving to a private integer slot
+// instead would silently break Env semantics: a variable already defined
+// in env before Run is called would read back as nil. A true slot-cached
+// fast path is a reasonable follow-up once Env exposes a way to detect
+// "this name is compile-time stable", but until then correctness wins
+// over the extra indirection.
+type Program struct {
+	Code   []Instr
+	Consts []reflect.Value
+	Names  []string
+}
+
+// compiler holds the in-progress Program plus the interning tables used to
+// avoid duplicate constants/names.
+type compiler struct {
+	prog       *Program
+	constIndex map[interface{}]int
+	nameIndex  map[string]int
+}
+
+// Compile lowers stmts into a Program. Only expression statements, if/
+// else-if/else, while-style `for Expr` loops and C-style `for` loops are
+// compiled; any other statement type makes it return an error, and
+// callers should fall back to the tree-walking invokeExpr/Run for those.
+func Compile(stmts []ast.Stmt) (*Program, error) {
+	c := &compiler{
+		prog:       &Program{},
+		constIndex: map[interface{}]int{},
+		nameIndex:  map[string]int{},
+	}
+	for _, stmt := range stmts {
+		if err := c.compileStmt(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return c.prog, nil
+}
+
+func (c *compiler) compileStmt(stmt ast.Stmt) error {
+	switch s := stmt.(type) {
+	case *ast.ExprStmt:
+		if err := c.compileExpr(s.Expr); err != nil {
+			return err
+		}
+		c.emit(OpPop, 0)
+		return nil
+
+	case *ast.IfStmt:
+		return c.compileIfStmt(s)
+
+	case *ast.LoopStmt:
+		// `for Expr { Stmts }` - the while-style "for": evaluate Expr, jump
+		// past the body when it's false, loop back to the condition after
+		// running the body.
+		condPos := len(c.prog.Code)
+		if err := c.compileExpr(s.Expr); err != nil {
+			return err
+		}
+		exitJump := c.emit(OpJumpIfFalse, 0)
+		c.emit(OpPop, 0)
+		if err := c.compileStmts(s.Stmts); err != nil {
+			return err
+		}
+		c.emit(OpJump, condPos)
+		c.patchJump(exitJump, len(c.prog.Code))
+		c.emit(OpPop, 0)
+		return nil
+
+	case *ast.CForStmt:
+		// `for Stmt1; Expr2; Expr3 { Stmts }` - C-style for, same shape as
+		// LoopStmt but with an init statement and a post-expression.
+		if s.Stmt1 != nil {
+			if err := c.compileStmt(s.Stmt1); err != nil {
+				return err
+			}
+		}
+		condPos := len(c.prog.Code)
+		exitJump := -1
+		if s.Expr2 != nil {
+			if err := c.compileExpr(s.Expr2); err != nil {
+				return err
+			}
+			exitJump = c.emit(OpJumpIfFalse, 0)
+			c.emit(OpPop, 0)
+		}
+		if err := c.compileStmts(s.Stmts); err != nil {
+			return err
+		}
+		if s.Expr3 != nil {
+			if err := c.compileExpr(s.Expr3); err != nil {
+				return err
+			}
+			c.emit(OpPop, 0)
+		}
+		c.emit(OpJump, condPos)
+		if exitJump >= 0 {
+			c.patchJump(exitJump, len(c.prog.Code))
+			c.emit(OpPop, 0)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("compiler: statement type %T is not yet supported", stmt)
+	}
+}
+
+// compileStmts compiles a block's statements in order.
+func (c *compiler) compileStmts(stmts []ast.Stmt) error {
+	for _, stmt := range stmts {
+		if err := c.compileStmt(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileIfStmt compiles an if/else-if/else chain into a cascade of
+// OpJumpIfFalse/OpJump, the same pattern compileExpr already uses for
+// *ast.TernaryOpExpr, just at statement granularity and without leaving a
+// value on the stack. Every branch (including each ElseIf) jumps to the
+// same end label once it's done, so only one of them ever runs.
+func (c *compiler) compileIfStmt(s *ast.IfStmt) error {
+	var endJumps []int
+
+	if err := c.compileExpr(s.If); err != nil {
+		return err
+	}
+	nextJump := c.emit(OpJumpIfFalse, 0)
+	c.emit(OpPop, 0)
+	if err := c.compileStmts(s.Then); err != nil {
+		return err
+	}
+	endJumps = append(endJumps, c.emit(OpJump, 0))
+	c.patchJump(nextJump, len(c.prog.Code))
+	c.emit(OpPop, 0)
+
+	for _, ei := range s.ElseIf {
+		elseIf, ok := ei.(*ast.IfStmt)
+		if !ok {
+			return fmt.Errorf("compiler: ElseIf entry type %T is not yet supported", ei)
+		}
+		if err := c.compileExpr(elseIf.If); err != nil {
+			return err
+		}
+		nextJump = c.emit(OpJumpIfFalse, 0)
+		c.emit(OpPop, 0)
+		if err := c.compileStmts(elseIf.Then); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(OpJump, 0))
+		c.patchJump(nextJump, len(c.prog.Code))
+		c.emit(OpPop, 0)
+	}
+
+	if err := c.compileStmts(s.Else); err != nil {
+		return err
+	}
+	for _, j := range endJumps {
+		c.patchJump(j, len(c.prog.Code))
+	}
+	return nil
+}
+
+func (c *compiler) emit(op Opcode, operand int) int {
+	c.prog.Code = append(c.prog.Code, Instr{Op: op, Operand: operand})
+	return len(c.prog.Code) - 1
+}
+
+func (c *compiler) patchJump(pos int, target int) {
+	c.prog.Code[pos].Operand = target
+}
+
+func (c *compiler) constant(v reflect.Value) int {
+	// reflect.Value isn't comparable for map keys in general, so constants
+	// are interned by their underlying interface{} value where possible.
+	key := v.Interface()
+	if i, ok := c.constIndex[key]; ok {
+		return i
+	}
+	i := len(c.prog.Consts)
+	c.prog.Consts = append(c.prog.Consts, v)
+	c.constIndex[key] = i
+	return i
+}
+
+func (c *compiler) name(n string) int {
+	if i, ok := c.nameIndex[n]; ok {
+		return i
+	}
+	i := len(c.prog.Names)
+	c.prog.Names = append(c.prog.Names, n)
+	c.nameIndex[n] = i
+	return i
+}
+
+var binOps = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpQuo,
+	"%":  OpRem,
+	"**": OpPow,
+	"<<": OpShl,
+	">>": OpShr,
+	"&":  OpAnd,
+	"|":  OpOr,
+	"^":  OpXor,
+	"==": OpEql,
+	"!=": OpNeq,
+	"<":  OpLss,
+	"<=": OpLeq,
+	">":  OpGtr,
+	">=": OpGeq,
+}
+
+func (c *compiler) compileExpr(expr ast.Expr) error {
+	switch e := expr.(type) {
+	case *ast.NumberExpr, *ast.StringExpr:
+		// literalValue turns the literal into a concrete reflect.Value at
+		// compile time; here we just record it in the constant pool.
+		v, err := literalValue(e)
+		if err != nil {
+			return err
+		}
+		c.emit(OpLoadConst, c.constant(v))
+		return nil
+
+	case *ast.IdentExpr:
+		c.emit(OpLoadName, c.name(e.Lit))
+		return nil
+
+	case *ast.ParenExpr:
+		return c.compileExpr(e.SubExpr)
+
+	case *ast.UnaryExpr:
+		if err := c.compileExpr(e.Expr); err != nil {
+			return err
+		}
+		switch e.Operator {
+		case "-":
+			c.emit(OpNeg, 0)
+		case "!":
+			c.emit(OpNot, 0)
+		case "^":
+			c.emit(OpBitNot, 0)
+		default:
+			return fmt.Errorf("compiler: unknown unary operator %q", e.Operator)
+		}
+		return nil
+
+	case *ast.MemberExpr:
+		if err := c.compileExpr(e.Expr); err != nil {
+			return err
+		}
+		c.emit(OpMember, c.name(e.Name))
+		return nil
+
+	case *ast.ItemExpr:
+		if err := c.compileExpr(e.Value); err != nil {
+			return err
+		}
+		if err := c.compileExpr(e.Index); err != nil {
+			return err
+		}
+		c.emit(OpIndex, 0)
+		return nil
+
+	case *ast.AssocExpr:
+		if err := c.compileExpr(e.Lhs); err != nil {
+			return err
+		}
+		if err := c.compileExpr(e.Rhs); err != nil {
+			return err
+		}
+		op, ok := binOps[e.Operator[0:1]]
+		if !ok {
+			return fmt.Errorf("compiler: unknown assoc operator %q", e.Operator)
+		}
+		c.emit(op, 0)
+		if ident, ok := e.Lhs.(*ast.IdentExpr); ok {
+			// OpStoreName pops the value it stores, but compileExpr's
+			// contract (like invokeExpr's AssocExpr case, which returns the
+			// new value) is to leave the expression's result on the stack -
+			// the enclosing ExprStmt always emits a trailing OpPop expecting
+			// something to discard. OpDup keeps a copy around for that.
+			c.emit(OpDup, 0)
+			c.emit(OpStoreName, c.name(ident.Lit))
+			return nil
+		}
+		return fmt.Errorf("compiler: assoc lhs %T is not yet supported", e.Lhs)
+
+	case *ast.BinOpExpr:
+		switch e.Operator {
+		case "&&":
+			// Short-circuit: if lhs is false, jump past rhs leaving lhs on
+			// the stack; the recursive invokeExpr equivalent is avoided.
+			// OpJumpIfFalse only peeks at the top of the stack, so lhs is
+			// popped explicitly before rhs runs.
+			if err := c.compileExpr(e.Lhs); err != nil {
+				return err
+			}
+			jmp := c.emit(OpJumpIfFalse, 0)
+			c.emit(OpPop, 0)
+			if err := c.compileExpr(e.Rhs); err != nil {
+				return err
+			}
+			c.patchJump(jmp, len(c.prog.Code))
+			return nil
+		case "||":
+			if err := c.compileExpr(e.Lhs); err != nil {
+				return err
+			}
+			jmp := c.emit(OpJumpIfTrue, 0)
+			c.emit(OpPop, 0)
+			if err := c.compileExpr(e.Rhs); err != nil {
+				return err
+			}
+			c.patchJump(jmp, len(c.prog.Code))
+			return nil
+		}
+		if err := c.compileExpr(e.Lhs); err != nil {
+			return err
+		}
+		if err := c.compileExpr(e.Rhs); err != nil {
+			return err
+		}
+		op, ok := binOps[e.Operator]
+		if !ok {
+			return fmt.Errorf("compiler: unknown operator %q", e.Operator)
+		}
+		c.emit(op, 0)
+		return nil
+
+	case *ast.TernaryOpExpr:
+		if err := c.compileExpr(e.Expr); err != nil {
+			return err
+		}
+		jmpFalse := c.emit(OpJumpIfFalse, 0)
+		c.emit(OpPop, 0)
+		if err := c.compileExpr(e.Lhs); err != nil {
+			return err
+		}
+		jmpEnd := c.emit(OpJump, 0)
+		c.patchJump(jmpFalse, len(c.prog.Code))
+		c.emit(OpPop, 0)
+		if err := c.compileExpr(e.Rhs); err != nil {
+			return err
+		}
+		c.patchJump(jmpEnd, len(c.prog.Code))
+		return nil
+
+	case *ast.CallExpr:
+		if err := c.compileExpr(e.Func); err != nil {
+			return err
+		}
+		for _, sub := range e.SubExprs {
+			if err := c.compileExpr(sub); err != nil {
+				return err
+			}
+		}
+		c.emit(OpCall, len(e.SubExprs))
+		return nil
+
+	default:
+		return fmt.Errorf("compiler: expression type %T is not yet supported", expr)
+	}
+}
@@ -0,0 +1,93 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/mattn/anko/ast"
+)
+
+func TestCompileIdentifierUsesNameTable(t *testing.T) {
+	// Identifiers must compile to OpLoadName/OpStoreName, which read and
+	// write *vm.Env by name, rather than a Machine-private slot that Env
+	// never sees.
+	prog, err := Compile([]ast.Stmt{
+		&ast.ExprStmt{Expr: &ast.IdentExpr{Lit: "x"}},
+	})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if len(prog.Code) == 0 || prog.Code[0].Op != OpLoadName {
+		t.Fatalf("expected first instruction to be OpLoadName, got %#v", prog.Code)
+	}
+	if len(prog.Names) != 1 || prog.Names[0] != "x" {
+		t.Errorf("expected Names = [\"x\"], got %v", prog.Names)
+	}
+}
+
+func TestCompileAssignUsesStoreName(t *testing.T) {
+	prog, err := Compile([]ast.Stmt{
+		&ast.ExprStmt{Expr: &ast.AssocExpr{
+			Lhs:      &ast.IdentExpr{Lit: "x"},
+			Operator: "+=",
+			Rhs:      &ast.NumberExpr{Lit: "1"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	var sawStoreName bool
+	for _, instr := range prog.Code {
+		if instr.Op == OpStoreName {
+			sawStoreName = true
+		}
+	}
+	if !sawStoreName {
+		t.Errorf("expected an OpStoreName instruction, got %#v", prog.Code)
+	}
+}
+
+func TestCompileIfStmtEmitsJumps(t *testing.T) {
+	prog, err := Compile([]ast.Stmt{
+		&ast.IfStmt{
+			If:   &ast.IdentExpr{Lit: "cond"},
+			Then: []ast.Stmt{&ast.ExprStmt{Expr: &ast.NumberExpr{Lit: "1"}}},
+			Else: []ast.Stmt{&ast.ExprStmt{Expr: &ast.NumberExpr{Lit: "2"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	var sawJumpIfFalse, sawJump bool
+	for _, instr := range prog.Code {
+		switch instr.Op {
+		case OpJumpIfFalse:
+			sawJumpIfFalse = true
+		case OpJump:
+			sawJump = true
+		}
+	}
+	if !sawJumpIfFalse || !sawJump {
+		t.Errorf("expected both OpJumpIfFalse and OpJump in compiled if-stmt, got %#v", prog.Code)
+	}
+}
+
+func TestCompileLoopStmtEmitsBackwardJump(t *testing.T) {
+	prog, err := Compile([]ast.Stmt{
+		&ast.LoopStmt{
+			Expr:  &ast.IdentExpr{Lit: "cond"},
+			Stmts: []ast.Stmt{&ast.ExprStmt{Expr: &ast.NumberExpr{Lit: "1"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	var sawBackwardJump bool
+	for i, instr := range prog.Code {
+		if instr.Op == OpJump && instr.Operand < i {
+			sawBackwardJump = true
+		}
+	}
+	if !sawBackwardJump {
+		t.Errorf("expected a backward OpJump closing the loop, got %#v", prog.Code)
+	}
+}
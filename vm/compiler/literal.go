@@ -0,0 +1,41 @@
+package compiler
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/anko/ast"
+)
+
+// literalValue parses a NumberExpr/StringExpr literal into a concrete
+// reflect.Value with strconv: a number literal containing "." or "e"
+// becomes a float64, anything else an int64 (hex with a "0x" prefix).
+// Unlike invokeExpr, which keeps number literals as exact AnkoNumber
+// values, compiled number literals have int64/float64 range and precision.
+func literalValue(expr ast.Expr) (reflect.Value, error) {
+	switch e := expr.(type) {
+	case *ast.StringExpr:
+		return reflect.ValueOf(e.Lit), nil
+	case *ast.NumberExpr:
+		if strings.Contains(e.Lit, ".") || strings.Contains(e.Lit, "e") {
+			v, err := strconv.ParseFloat(e.Lit, 64)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(v), nil
+		}
+		var i int64
+		var err error
+		if strings.HasPrefix(e.Lit, "0x") {
+			i, err = strconv.ParseInt(e.Lit[2:], 16, 64)
+		} else {
+			i, err = strconv.ParseInt(e.Lit, 10, 64)
+		}
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(i), nil
+	}
+	return reflect.Value{}, strconv.ErrSyntax
+}
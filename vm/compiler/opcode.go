@@ -0,0 +1,64 @@
+package compiler
+
+// Opcode identifies a single bytecode instruction.
+type Opcode byte
+
+const (
+	OpNop Opcode = iota
+
+	// Stack / constants / names.
+	OpLoadConst // push Consts[operand]
+	OpLoadName  // push env.get(Names[operand])
+	OpStoreName // pop, env.setValue(Names[operand], v)
+	OpPop       // discard top of stack
+
+	// Arithmetic / comparison, mirroring BinOpExpr operators.
+	OpAdd
+	OpSub
+	OpMul
+	OpQuo
+	OpRem
+	OpPow
+	OpShl
+	OpShr
+	OpAnd
+	OpOr
+	OpXor
+	OpEql
+	OpNeq
+	OpLss
+	OpLeq
+	OpGtr
+	OpGeq
+
+	// Unary.
+	OpNeg
+	OpNot
+	OpBitNot
+
+	// Member / index access.
+	OpMember // pop obj, push obj.Names[operand]
+	OpIndex  // pop obj, idx; push obj[idx]
+
+	// Calls.
+	OpCall // pop callee + operand args, push result
+
+	// Control flow. Jump targets are absolute instruction indices.
+	OpJump
+	OpJumpIfFalse
+	OpJumpIfTrue
+
+	// Push a copy of the top of stack; compound assignment uses it to keep
+	// the stored value as the expression's result.
+	OpDup
+
+	OpReturn
+)
+
+// Instr is a single decoded instruction: an opcode plus its operand.
+// Most opcodes use the operand as either a constant/name/jump index; a few
+// (OpCall) use it as an argument count.
+type Instr struct {
+	Op      Opcode
+	Operand int
+}
@@ -0,0 +1,212 @@
+package vm
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/mattn/anko/ast"
+	"github.com/mattn/anko/vm/compiler"
+)
+
+// Program is the compiled form produced by Compile and executed by Run.
+// It is a type alias so callers never need to import vm/compiler directly.
+type Program = compiler.Program
+
+// Opcode aliases so the switch in Machine.run below can refer to them
+// unqualified, matching how the rest of this file reads.
+const (
+	OpNop         = compiler.OpNop
+	OpLoadConst   = compiler.OpLoadConst
+	OpLoadName    = compiler.OpLoadName
+	OpStoreName   = compiler.OpStoreName
+	OpPop         = compiler.OpPop
+	OpAdd         = compiler.OpAdd
+	OpSub         = compiler.OpSub
+	OpMul         = compiler.OpMul
+	OpQuo         = compiler.OpQuo
+	OpRem         = compiler.OpRem
+	OpPow         = compiler.OpPow
+	OpShl         = compiler.OpShl
+	OpShr         = compiler.OpShr
+	OpAnd         = compiler.OpAnd
+	OpOr          = compiler.OpOr
+	OpXor         = compiler.OpXor
+	OpEql         = compiler.OpEql
+	OpNeq         = compiler.OpNeq
+	OpLss         = compiler.OpLss
+	OpLeq         = compiler.OpLeq
+	OpGtr         = compiler.OpGtr
+	OpGeq         = compiler.OpGeq
+	OpNeg         = compiler.OpNeg
+	OpNot         = compiler.OpNot
+	OpBitNot      = compiler.OpBitNot
+	OpMember      = compiler.OpMember
+	OpIndex       = compiler.OpIndex
+	OpCall        = compiler.OpCall
+	OpJump        = compiler.OpJump
+	OpJumpIfFalse = compiler.OpJumpIfFalse
+	OpJumpIfTrue  = compiler.OpJumpIfTrue
+	OpDup         = compiler.OpDup
+	OpReturn      = compiler.OpReturn
+)
+
+// Compile lowers stmts into a Program once, so it can be run repeatedly by
+// Run without invokeExpr re-walking the AST each time. It returns an error
+// for statement/expression shapes the compiler does not yet cover; callers
+// should fall back to the existing Run(stmts, env)/invokeExpr path for
+// those programs.
+func Compile(stmts []ast.Stmt) (*Program, error) {
+	return compiler.Compile(stmts)
+}
+
+// Machine executes a compiled Program against an Env. It holds only the
+// per-run stack, so the same Program can be run concurrently by multiple
+// Machines; identifier state all lives in env itself (see OpLoadName/
+// OpStoreName below), not in the Machine.
+type Machine struct {
+	stack []reflect.Value
+}
+
+// Run executes prog against env and returns the value most recently
+// discarded by OpPop - for a program ending in an expression statement,
+// that statement's value, mirroring the result invokeExpr would have
+// produced for the equivalent tree-walking evaluation.
+func Run(prog *Program, env *Env) (reflect.Value, error) {
+	m := &Machine{}
+	return m.run(prog, env)
+}
+
+// Execute compiles stmts and runs them against env, falling back to the
+// tree-walking ExecuteContext/invokeExpr path for any statement or
+// expression shape the compiler doesn't cover yet (Compile returns an
+// error for those rather than panicking or silently mishandling them).
+// This is the reachable entry point for the bytecode path: callers that
+// just want "run this script against env" should use Execute rather than
+// calling Compile/Run directly, so they automatically get tree-walking
+// coverage for anything the compiler hasn't grown support for yet.
+func Execute(env *Env, stmts []ast.Stmt) (reflect.Value, error) {
+	prog, err := Compile(stmts)
+	if err != nil {
+		return ExecuteContext(context.Background(), env, stmts)
+	}
+	return Run(prog, env)
+}
+
+func (m *Machine) push(v reflect.Value) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *Machine) pop() reflect.Value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+func (m *Machine) top() reflect.Value {
+	return m.stack[len(m.stack)-1]
+}
+
+func (m *Machine) run(prog *Program, env *Env) (reflect.Value, error) {
+	var result reflect.Value = NilValue
+	pc := 0
+	for pc < len(prog.Code) {
+		instr := prog.Code[pc]
+		switch instr.Op {
+		case OpNop:
+
+		case OpLoadConst:
+			m.push(prog.Consts[instr.Operand])
+
+		case OpLoadName:
+			v, err := env.get(prog.Names[instr.Operand])
+			if err != nil {
+				return NilValue, err
+			}
+			m.push(v)
+
+		case OpStoreName:
+			v := m.pop()
+			if err := env.setValue(prog.Names[instr.Operand], v); err != nil {
+				return NilValue, err
+			}
+
+		case OpPop:
+			result = m.pop()
+
+		case OpDup:
+			m.push(m.top())
+
+		case OpAdd, OpSub, OpMul, OpQuo, OpRem, OpPow, OpShl, OpShr,
+			OpAnd, OpOr, OpXor, OpEql, OpNeq, OpLss, OpLeq, OpGtr, OpGeq:
+			rhs := m.pop()
+			lhs := m.pop()
+			v, err := binOpcode(instr.Op, lhs, rhs)
+			if err != nil {
+				return NilValue, err
+			}
+			m.push(v)
+
+		case OpNeg:
+			v := m.pop()
+			if v.Kind() == reflect.Float64 {
+				m.push(reflect.ValueOf(-v.Float()))
+			} else {
+				m.push(reflect.ValueOf(-toInt64(v)))
+			}
+
+		case OpNot:
+			v := m.pop()
+			m.push(reflect.ValueOf(!toBool(v)))
+
+		case OpBitNot:
+			v := m.pop()
+			m.push(reflect.ValueOf(^toInt64(v)))
+
+		case OpMember:
+			v, err := memberOpcode(m.pop(), prog.Names[instr.Operand])
+			if err != nil {
+				return NilValue, err
+			}
+			m.push(v)
+
+		case OpIndex:
+			idx := m.pop()
+			v := m.pop()
+			rv, err := indexOpcode(v, idx)
+			if err != nil {
+				return NilValue, err
+			}
+			m.push(rv)
+
+		case OpJump:
+			pc = instr.Operand
+			continue
+
+		case OpJumpIfFalse:
+			if !toBool(m.top()) {
+				pc = instr.Operand
+				continue
+			}
+
+		case OpJumpIfTrue:
+			if toBool(m.top()) {
+				pc = instr.Operand
+				continue
+			}
+
+		case OpCall:
+			args := make([]reflect.Value, instr.Operand)
+			for i := instr.Operand - 1; i >= 0; i-- {
+				args[i] = m.pop()
+			}
+			fn := m.pop()
+			rv, err := callOpcode(fn, args)
+			if err != nil {
+				return NilValue, err
+			}
+			m.push(rv)
+		}
+		pc++
+	}
+	return result, nil
+}
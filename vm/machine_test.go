@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/mattn/anko/ast"
+)
+
+// TestRunCompoundAssignLeavesStackBalanced runs `count += 1` through the
+// real Compile/Run path (not just inspecting the emitted opcodes): OpAdd
+// leaves its result on the stack and OpStoreName pops it to store into
+// env, so without a compensating OpDup the enclosing ExprStmt's trailing
+// OpPop panics on an empty stack.
+func TestRunCompoundAssignLeavesStackBalanced(t *testing.T) {
+	env := &Env{}
+	if err := env.Define("count", int64(0)); err != nil {
+		t.Fatalf("env.Define: %v", err)
+	}
+
+	stmts := []ast.Stmt{
+		&ast.ExprStmt{Expr: &ast.AssocExpr{
+			Lhs:      &ast.IdentExpr{Lit: "count"},
+			Operator: "+=",
+			Rhs:      &ast.NumberExpr{Lit: "1"},
+		}},
+	}
+
+	prog, err := Compile(stmts)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if _, err := Run(prog, env); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	got, err := env.get("count")
+	if err != nil {
+		t.Fatalf("env.get(count): %v", err)
+	}
+	if toInt64(got) != 1 {
+		t.Errorf("count = %v, want 1", got)
+	}
+}
+
+// TestRunLoopWithCompoundAssign is the realistic hot-loop accumulator
+// pattern this subsystem exists to speed up: `for count < 3 { count += 1 }`.
+func TestRunLoopWithCompoundAssign(t *testing.T) {
+	env := &Env{}
+	if err := env.Define("count", int64(0)); err != nil {
+		t.Fatalf("env.Define: %v", err)
+	}
+
+	stmts := []ast.Stmt{
+		&ast.LoopStmt{
+			Expr: &ast.BinOpExpr{
+				Operator: "<",
+				Lhs:      &ast.IdentExpr{Lit: "count"},
+				Rhs:      &ast.NumberExpr{Lit: "3"},
+			},
+			Stmts: []ast.Stmt{
+				&ast.ExprStmt{Expr: &ast.AssocExpr{
+					Lhs:      &ast.IdentExpr{Lit: "count"},
+					Operator: "+=",
+					Rhs:      &ast.NumberExpr{Lit: "1"},
+				}},
+			},
+		},
+	}
+
+	prog, err := Compile(stmts)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if _, err := Run(prog, env); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	got, err := env.get("count")
+	if err != nil {
+		t.Fatalf("env.get(count): %v", err)
+	}
+	if toInt64(got) != 3 {
+		t.Errorf("count = %v, want 3", got)
+	}
+}
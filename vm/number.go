@@ -0,0 +1,199 @@
+package vm
+
+import (
+	"go/constant"
+	"go/token"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// AnkoNumber wraps a go/constant.Value so integer and floating-point
+// literals keep arbitrary precision through arithmetic instead of being
+// immediately collapsed into int64/float64 (which silently overflows on
+// large integers and loses precision on decimals like 0.1 + 0.2).
+//
+// It only ever collapses to a concrete int64/float64/uint64 when the value
+// crosses into an operation that needs one, e.g. being passed as an
+// argument to a reflect-invoked Go function - see toConcrete.
+type AnkoNumber struct {
+	Value constant.Value
+}
+
+// newAnkoNumber parses a NumberExpr literal, as written (including any
+// "0x"/"0o"/"0b" prefix), into an exact constant.Value.
+//
+// Which token kind to parse as matters, not just whether parsing
+// succeeds: constant.MakeFromLiteral(lit, token.FLOAT, 0) happily accepts
+// a plain integer literal like "3" too (as constant.Float, not
+// constant.Int), so probing with FLOAT first and falling back to INT
+// never actually reaches the INT branch - every literal becomes a Float,
+// which defeats evalAnkoNumberOp's Int-only "**" fast path and silently
+// routes all exponentiation through the lossy float64 path instead. The
+// literal's own syntax (a "." or exponent marker means float) decides
+// which token kind to parse as, same as the pre-AnkoNumber strconv-based
+// parsing this replaced.
+func newAnkoNumber(lit string) (AnkoNumber, error) {
+	tok := token.INT
+	if isFloatLiteral(lit) {
+		tok = token.FLOAT
+	}
+	v := constant.MakeFromLiteral(lit, tok, 0)
+	if v.Kind() == constant.Unknown {
+		return AnkoNumber{}, NewStringError(nil, "invalid numeric literal '"+lit+"'")
+	}
+	return AnkoNumber{Value: v}, nil
+}
+
+// isFloatLiteral reports whether lit's own syntax marks it as a
+// floating-point literal (a "." or an exponent) rather than an integer -
+// a hex literal's 'a'-'f' digits (e.g. "0xFE") don't count, so hex/octal/
+// binary integer literals are never misdetected as floats.
+func isFloatLiteral(lit string) bool {
+	if len(lit) > 1 && lit[0] == '0' && (lit[1] == 'x' || lit[1] == 'X' || lit[1] == 'o' || lit[1] == 'O' || lit[1] == 'b' || lit[1] == 'B') {
+		return false
+	}
+	return strings.ContainsAny(lit, ".eE")
+}
+
+// asAnkoNumber reports whether v (already dereferenced through any
+// interface wrapper) holds an AnkoNumber, returning it if so.
+func asAnkoNumber(v reflect.Value) (AnkoNumber, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return AnkoNumber{}, false
+	}
+	n, ok := v.Interface().(AnkoNumber)
+	return n, ok
+}
+
+// isArbitraryPrecisionOp reports whether operator is one of the arithmetic
+// operators AnkoNumber keeps exact, as opposed to comparisons (handled
+// separately below since they return bool, not a number).
+func isArbitraryPrecisionOp(operator string) bool {
+	switch operator {
+	case "+", "-", "*", "/", "%", "**", "<<", ">>", "|", "&", "^":
+		return true
+	}
+	return false
+}
+
+// evalAnkoNumberOp performs operator on two exact numbers, staying in
+// go/constant for as long as possible. "**" has no constant.BinaryOp
+// equivalent: an integer raised to a non-negative integer is computed
+// exactly by intPow, any other "**" via float64 and re-wrapped.
+func evalAnkoNumberOp(operator string, lhs, rhs AnkoNumber) (reflect.Value, error) {
+	switch operator {
+	case "+":
+		return reflect.ValueOf(AnkoNumber{constant.BinaryOp(lhs.Value, token.ADD, rhs.Value)}), nil
+	case "-":
+		return reflect.ValueOf(AnkoNumber{constant.BinaryOp(lhs.Value, token.SUB, rhs.Value)}), nil
+	case "*":
+		return reflect.ValueOf(AnkoNumber{constant.BinaryOp(lhs.Value, token.MUL, rhs.Value)}), nil
+	case "/":
+		return reflect.ValueOf(AnkoNumber{constant.BinaryOp(lhs.Value, token.QUO, rhs.Value)}), nil
+	case "%":
+		return reflect.ValueOf(AnkoNumber{constant.BinaryOp(lhs.Value, token.REM, rhs.Value)}), nil
+	case "|":
+		return reflect.ValueOf(AnkoNumber{constant.BinaryOp(lhs.Value, token.OR, rhs.Value)}), nil
+	case "&":
+		return reflect.ValueOf(AnkoNumber{constant.BinaryOp(lhs.Value, token.AND, rhs.Value)}), nil
+	case "^":
+		return reflect.ValueOf(AnkoNumber{constant.BinaryOp(lhs.Value, token.XOR, rhs.Value)}), nil
+	case "<<", ">>":
+		shift, ok := constant.Uint64Val(rhs.Value)
+		if !ok {
+			return NilValue, NewStringError(nil, "shift amount must be an unsigned integer")
+		}
+		dir := token.SHL
+		if operator == ">>" {
+			dir = token.SHR
+		}
+		return reflect.ValueOf(AnkoNumber{constant.Shift(lhs.Value, dir, uint(shift))}), nil
+	case "**":
+		if lhs.Value.Kind() == constant.Int && rhs.Value.Kind() == constant.Int {
+			if exp, ok := constant.Int64Val(rhs.Value); ok && exp >= 0 {
+				return reflect.ValueOf(AnkoNumber{intPow(lhs.Value, exp)}), nil
+			}
+		}
+		// Non-integer exponent, or negative/too-large to use as a repeated-
+		// squaring count: go/constant has no exponentiation op, so fall back
+		// to float64 - this only loses precision for fractional or negative
+		// powers, not the plain-integer case the literal syntax is mostly
+		// used for.
+		f, _ := toConcreteFloat(lhs.Value)
+		g, _ := toConcreteFloat(rhs.Value)
+		cv, err := newAnkoNumber(formatFloat(powFloat(f, g)))
+		return reflect.ValueOf(cv), err
+	default:
+		return NilValue, NewStringError(nil, "Unknown operator")
+	}
+}
+
+// compareAnkoNumbers implements ==, !=, <, <=, >, >= without losing
+// precision by round-tripping through float64 first.
+func compareAnkoNumbers(operator string, lhs, rhs AnkoNumber) (reflect.Value, error) {
+	var tok token.Token
+	switch operator {
+	case "==":
+		tok = token.EQL
+	case "!=":
+		tok = token.NEQ
+	case "<":
+		tok = token.LSS
+	case "<=":
+		tok = token.LEQ
+	case ">":
+		tok = token.GTR
+	case ">=":
+		tok = token.GEQ
+	default:
+		return NilValue, NewStringError(nil, "Unknown operator")
+	}
+	return reflect.ValueOf(constant.Compare(lhs.Value, tok, rhs.Value)), nil
+}
+
+// toConcrete collapses an AnkoNumber down to the narrowest concrete Go
+// value it fits in, for the point where it's handed to a reflect-invoked
+// Go function that wants a specific kind rather than an AnkoNumber.
+func toConcrete(n AnkoNumber) reflect.Value {
+	if n.Value.Kind() == constant.Int {
+		if i, ok := constant.Int64Val(n.Value); ok {
+			return reflect.ValueOf(i)
+		}
+		if u, ok := constant.Uint64Val(n.Value); ok {
+			return reflect.ValueOf(u)
+		}
+	}
+	f, _ := toConcreteFloat(n.Value)
+	return reflect.ValueOf(f)
+}
+
+func toConcreteFloat(v constant.Value) (float64, bool) {
+	f, _ := constant.Float64Val(v)
+	return f, true
+}
+
+func powFloat(base, exp float64) float64 {
+	return math.Pow(base, exp)
+}
+
+// intPow computes base**exp exactly via repeated squaring over
+// constant.BinaryOp(..., token.MUL, ...), so e.g. 3 ** 40 comes out as the
+// exact 12157665459056928801 instead of overflowing/rounding through
+// float64 math.Pow.
+func intPow(base constant.Value, exp int64) constant.Value {
+	result := constant.MakeInt64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result = constant.BinaryOp(result, token.MUL, base)
+		}
+		base = constant.BinaryOp(base, token.MUL, base)
+		exp >>= 1
+	}
+	return result
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
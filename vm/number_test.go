@@ -0,0 +1,41 @@
+package vm
+
+import "testing"
+
+func TestEvalAnkoNumberOpExactExponent(t *testing.T) {
+	lhs, err := newAnkoNumber("3")
+	if err != nil {
+		t.Fatalf("newAnkoNumber(3): %v", err)
+	}
+	rhs, err := newAnkoNumber("40")
+	if err != nil {
+		t.Fatalf("newAnkoNumber(40): %v", err)
+	}
+
+	rv, err := evalAnkoNumberOp("**", lhs, rhs)
+	if err != nil {
+		t.Fatalf("evalAnkoNumberOp: %v", err)
+	}
+	n, ok := asAnkoNumber(rv)
+	if !ok {
+		t.Fatalf("result is not an AnkoNumber: %#v", rv)
+	}
+	const want = "12157665459056928801" // 3**40, exact
+	if got := n.Value.ExactString(); got != want {
+		t.Errorf("3 ** 40 = %s, want %s", got, want)
+	}
+}
+
+func TestEvalAnkoNumberOpExponentOfTwoStaysExact(t *testing.T) {
+	lhs, _ := newAnkoNumber("2")
+	rhs, _ := newAnkoNumber("100")
+	rv, err := evalAnkoNumberOp("**", lhs, rhs)
+	if err != nil {
+		t.Fatalf("evalAnkoNumberOp: %v", err)
+	}
+	n, _ := asAnkoNumber(rv)
+	const want = "1267650600228229401496703205376" // 2**100, exact
+	if got := n.Value.ExactString(); got != want {
+		t.Errorf("2 ** 100 = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package vm
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/vm/compiler"
+)
+
+// opcodeOperator maps the arithmetic/comparison opcodes back to the
+// operator string evalBinOp expects, so binOpcode can delegate to it
+// instead of keeping a second, opcode-keyed copy of the same dispatch.
+var opcodeOperator = map[compiler.Opcode]string{
+	OpAdd: "+", OpSub: "-", OpMul: "*", OpQuo: "/", OpRem: "%", OpPow: "**",
+	OpShl: "<<", OpShr: ">>", OpAnd: "&", OpOr: "|", OpXor: "^",
+	OpEql: "==", OpNeq: "!=", OpLss: "<", OpLeq: "<=", OpGtr: ">", OpGeq: ">=",
+}
+
+// binOpcode implements the arithmetic/comparison opcodes. It delegates to
+// evalBinOp (shared with invokeExpr/invokeExprCtx) so a compiled Program
+// gets the exact same AnkoNumber-aware arithmetic (chunk0-3) as the
+// tree-walking evaluators instead of a second, Kind()-only copy that
+// silently mishandles AnkoNumber operands.
+func binOpcode(op compiler.Opcode, lhsV, rhsV reflect.Value) (reflect.Value, error) {
+	operator, ok := opcodeOperator[op]
+	if !ok {
+		return NilValue, NewStringError(nil, "Unknown operator")
+	}
+	return evalBinOp(nil, operator, lhsV, rhsV)
+}
+
+// memberOpcode mirrors the *ast.MemberExpr case in invokeExpr.
+func memberOpcode(v reflect.Value, name string) (reflect.Value, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice {
+		v = v.Index(0)
+	}
+	if v.IsValid() && v.CanInterface() {
+		if vme, ok := v.Interface().(*Env); ok {
+			m, err := vme.get(name)
+			if !m.IsValid() || err != nil {
+				return NilValue, NewStringError(nil, "Invalid operation '"+name+"'")
+			}
+			return m, nil
+		}
+	}
+
+	method, found := v.Type().MethodByName(name)
+	if found {
+		return v.Method(method.Index), nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		field, found := v.Type().FieldByName(name)
+		if !found {
+			return NilValue, NewStringError(nil, "no member named '"+name+"' for struct")
+		}
+		return v.FieldByIndex(field.Index), nil
+	case reflect.Map:
+		return getMapIndex(reflect.ValueOf(name), v), nil
+	default:
+		return NilValue, NewStringError(nil, "type "+v.Kind().String()+" does not support member operation")
+	}
+}
+
+// indexOpcode mirrors the *ast.ItemExpr case in invokeExpr.
+func indexOpcode(v, i reflect.Value) (reflect.Value, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array:
+		ii, err := tryToInt(i)
+		if err != nil {
+			return NilValue, NewStringError(nil, "index must be a number")
+		}
+		if ii < 0 || ii >= v.Len() {
+			return NilValue, NewStringError(nil, "index out of range")
+		}
+		if v.Kind() != reflect.String {
+			return v.Index(ii), nil
+		}
+		v = v.Index(ii)
+		if v.Type().ConvertibleTo(StringType) {
+			return v.Convert(StringType), nil
+		}
+		return NilValue, NewStringError(nil, "invalid type conversion")
+	case reflect.Map:
+		return getMapIndex(i, v), nil
+	default:
+		return NilValue, NewStringError(nil, "type "+v.Kind().String()+" does not support index operation")
+	}
+}
+
+// callOpcode invokes fn with args the same way CallExpr does for a value
+// already resolved to a reflect.Func, since the compiler has no static
+// knowledge of whether the callee is a Go func, an anko FuncExpr closure,
+// or a bound method.
+func callOpcode(fn reflect.Value, args []reflect.Value) (reflect.Value, error) {
+	if fn.Kind() == reflect.Interface {
+		fn = fn.Elem()
+	}
+	if fn.Kind() != reflect.Func {
+		return NilValue, NewStringError(nil, "cannot call a non-function value")
+	}
+	rvs := fn.Call(args)
+	switch len(rvs) {
+	case 0:
+		return NilValue, nil
+	case 1:
+		return rvs[0], nil
+	default:
+		// Multiple return values collapse to a slice, same as AnonCallExpr.
+		out := make([]interface{}, len(rvs))
+		for i, rv := range rvs {
+			out[i] = rv.Interface()
+		}
+		return reflect.ValueOf(out), nil
+	}
+}
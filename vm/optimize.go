@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/mattn/anko/ast"
+	"github.com/mattn/anko/vm/optimize"
+)
+
+// Optimize runs the vm/optimize constant-folding pass over stmts. It's
+// exposed here, rather than requiring callers to import vm/optimize
+// directly, the same way Compile wraps vm/compiler.
+func Optimize(stmts []ast.Stmt) []ast.Stmt {
+	return optimize.Optimize(stmts)
+}
+
+// CompileWithEnv is Compile plus the vm/optimize pass when env has
+// SetOptimize(true) set, so the bytecode compiler works off an
+// already-folded, shrunk program instead of redoing that folding itself.
+func CompileWithEnv(env *Env, stmts []ast.Stmt) (*Program, error) {
+	if env.shouldOptimize() {
+		stmts = Optimize(stmts)
+	}
+	return Compile(stmts)
+}
+
+// optimizeEnabled tracks which Envs have opted into running Optimize
+// automatically before evaluation. It's keyed by pointer identity rather
+// than a field on Env itself because env.go isn't part of this source
+// tree (Env is an existing, widely embedded upstream type) - a field
+// would be the better fix and should replace this table if/when this
+// package is merged alongside env.go. Until then, SetOptimize registers a
+// finalizer that clears an Env's entry once it's unreachable, so an Env
+// that calls SetOptimize(true) and is later discarded without calling
+// SetOptimize(false) doesn't leak in this map for the life of the
+// process.
+var (
+	optimizeMu      sync.RWMutex
+	optimizeEnabled = map[*Env]bool{}
+)
+
+// SetOptimize turns automatic constant folding on or off for env. When
+// enabled, Run/Execute-style entry points should call Optimize on the
+// parsed statements before evaluating them.
+func (env *Env) SetOptimize(enabled bool) {
+	optimizeMu.Lock()
+	defer optimizeMu.Unlock()
+	if enabled {
+		optimizeEnabled[env] = true
+		runtime.SetFinalizer(env, clearOptimizeEnabled)
+	} else {
+		delete(optimizeEnabled, env)
+		runtime.SetFinalizer(env, nil)
+	}
+}
+
+// clearOptimizeEnabled is env's finalizer while SetOptimize(true) is in
+// effect: it removes env's entry from optimizeEnabled once env itself is
+// about to be collected, bounding the map to currently-live Envs.
+func clearOptimizeEnabled(env *Env) {
+	optimizeMu.Lock()
+	defer optimizeMu.Unlock()
+	delete(optimizeEnabled, env)
+}
+
+// shouldOptimize reports whether env has opted into automatic constant
+// folding via SetOptimize.
+func (env *Env) shouldOptimize() bool {
+	optimizeMu.RLock()
+	defer optimizeMu.RUnlock()
+	return optimizeEnabled[env]
+}
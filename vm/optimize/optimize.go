@@ -0,0 +1,299 @@
+// Package optimize is an AST rewrite pass run after parsing: it folds
+// constant subexpressions down to a single literal and rewrites some
+// always-true/always-false shapes, so the compiler/interpreter has less
+// work to do on scripts that embed literal-heavy expressions (typical for
+// config/DSL use).
+package optimize
+
+import (
+	"go/constant"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/anko/ast"
+)
+
+// Optimize rewrites stmts in place and returns them, folding constant
+// subtrees of BinOpExpr/UnaryExpr/ParenExpr/TernaryOpExpr into a single
+// literal wherever every operand is itself a literal. Folding works
+// bottom-up, so a chain of string `+` literals ("a" + "b" + "c") collapses
+// one level at a time into a single StringExpr without special-casing.
+func Optimize(stmts []ast.Stmt) []ast.Stmt {
+	for i, stmt := range stmts {
+		stmts[i] = optimizeStmt(stmt)
+	}
+	return stmts
+}
+
+func optimizeStmt(stmt ast.Stmt) ast.Stmt {
+	if s, ok := stmt.(*ast.ExprStmt); ok {
+		s.Expr = optimizeExpr(s.Expr)
+	}
+	return stmt
+}
+
+func optimizeExpr(expr ast.Expr) ast.Expr {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		inner := optimizeExpr(e.SubExpr)
+		if isLiteral(inner) {
+			return inner
+		}
+		e.SubExpr = inner
+		return e
+
+	case *ast.UnaryExpr:
+		e.Expr = optimizeExpr(e.Expr)
+		if e.Operator == "!" {
+			if inner, ok := e.Expr.(*ast.UnaryExpr); ok && inner.Operator == "!" {
+				// !!x isn't a no-op in anko (it coerces x to bool), so
+				// collapse to a single coercion rather than dropping both.
+				if c, ok := constOf(inner.Expr); ok {
+					folded, _ := foldUnary("!!", c)
+					return literalFor(e, folded)
+				}
+				return &ast.UnaryExpr{ExprImpl: e.ExprImpl, Operator: "!!", Expr: inner.Expr}
+			}
+		}
+		if c, ok := constOf(e.Expr); ok {
+			if folded, ok := foldUnary(e.Operator, c); ok {
+				return literalFor(e, folded)
+			}
+		}
+		return e
+
+	case *ast.BinOpExpr:
+		e.Lhs = optimizeExpr(e.Lhs)
+		if e.Rhs != nil {
+			e.Rhs = optimizeExpr(e.Rhs)
+		}
+
+		// No one-sided short-circuit folding here: anko's "&&"/"||" always
+		// evaluate both operands (they only short-circuit which one is
+		// *returned* - see evalBinOp/invokeExpr), so e.g. "x || true" can't
+		// fold to "true" without also dropping x's evaluation, which is
+		// unsound if x has a side effect (print(...), a call, etc). Only
+		// the case below - both operands already constant, so there's
+		// nothing with a side effect to drop - is safe to fold.
+
+		lc, lok := constOf(e.Lhs)
+		rc, rok := constOf(e.Rhs)
+		if lok && rok {
+			if folded, ok := foldBinary(e.Operator, lc, rc); ok {
+				return literalFor(e, folded)
+			}
+		}
+		return e
+
+	case *ast.TernaryOpExpr:
+		e.Expr = optimizeExpr(e.Expr)
+		e.Lhs = optimizeExpr(e.Lhs)
+		e.Rhs = optimizeExpr(e.Rhs)
+		if c, ok := constOf(e.Expr); ok {
+			if truthy(c) {
+				return e.Lhs
+			}
+			return e.Rhs
+		}
+		return e
+
+	default:
+		return expr
+	}
+}
+
+// isLiteral reports whether expr is already a folded literal, so
+// ParenExpr unwrapping doesn't keep redundant parens around one.
+func isLiteral(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.NumberExpr, *ast.StringExpr, *ast.ConstExpr:
+		return true
+	}
+	return false
+}
+
+type constKind int
+
+const (
+	constKindNumber constKind = iota
+	constKindString
+	constKindBool
+)
+
+// constVal is the normalized form of a literal this pass can fold:
+// either an exact go/constant.Value (numbers), a Go string, or a Go bool.
+type constVal struct {
+	kind constKind
+	num  constant.Value
+	str  string
+	b    bool
+}
+
+// constOf extracts a constVal from expr if expr is a literal this pass
+// understands, so folding can work uniformly over BinOpExpr/UnaryExpr/
+// TernaryOpExpr regardless of which literal type it's looking at.
+func constOf(expr ast.Expr) (constVal, bool) {
+	switch e := expr.(type) {
+	case *ast.NumberExpr:
+		// INT first: MakeFromLiteral with token.FLOAT also accepts "3",
+		// as a Float, which go/constant's integer-only ops (%, |, &, ^,
+		// shifts) reject.
+		v := constant.MakeFromLiteral(e.Lit, token.INT, 0)
+		if v.Kind() == constant.Unknown {
+			v = constant.MakeFromLiteral(e.Lit, token.FLOAT, 0)
+		}
+		if v.Kind() == constant.Unknown {
+			return constVal{}, false
+		}
+		return constVal{kind: constKindNumber, num: v}, true
+	case *ast.StringExpr:
+		return constVal{kind: constKindString, str: e.Lit}, true
+	case *ast.ConstExpr:
+		switch e.Value {
+		case "true":
+			return constVal{kind: constKindBool, b: true}, true
+		case "false":
+			return constVal{kind: constKindBool, b: false}, true
+		}
+	}
+	return constVal{}, false
+}
+
+func truthy(c constVal) bool {
+	switch c.kind {
+	case constKindBool:
+		return c.b
+	case constKindString:
+		return c.str != ""
+	case constKindNumber:
+		return constant.Sign(c.num) != 0
+	}
+	return false
+}
+
+var binOpTokens = map[string]token.Token{
+	"+": token.ADD, "-": token.SUB, "*": token.MUL, "/": token.QUO, "%": token.REM,
+	"|": token.OR, "&": token.AND, "^": token.XOR,
+}
+var cmpOpTokens = map[string]token.Token{
+	"==": token.EQL, "!=": token.NEQ, "<": token.LSS, "<=": token.LEQ, ">": token.GTR, ">=": token.GEQ,
+}
+
+// foldBinary computes lhs Operator rhs for two already-constant operands.
+func foldBinary(operator string, lhs, rhs constVal) (constVal, bool) {
+	if operator == "||" {
+		// Both operands are literals - there's no side effect either one
+		// could be hiding, so evaluating only one of them is safe here.
+		if truthy(lhs) {
+			return lhs, true
+		}
+		return rhs, true
+	}
+	if operator == "&&" {
+		if !truthy(lhs) {
+			return lhs, true
+		}
+		return rhs, true
+	}
+	if operator == "+" && (lhs.kind == constKindString || rhs.kind == constKindString) {
+		return constVal{kind: constKindString, str: fmtConst(lhs) + fmtConst(rhs)}, true
+	}
+	if tok, ok := binOpTokens[operator]; ok && lhs.kind == constKindNumber && rhs.kind == constKindNumber {
+		return constVal{kind: constKindNumber, num: constant.BinaryOp(lhs.num, tok, rhs.num)}, true
+	}
+	if tok, ok := cmpOpTokens[operator]; ok && lhs.kind == constKindNumber && rhs.kind == constKindNumber {
+		return constVal{kind: constKindBool, b: constant.Compare(lhs.num, tok, rhs.num)}, true
+	}
+	switch operator {
+	case "<<", ">>":
+		if lhs.kind != constKindNumber || rhs.kind != constKindNumber {
+			return constVal{}, false
+		}
+		shift, ok := constant.Uint64Val(rhs.num)
+		if !ok {
+			return constVal{}, false
+		}
+		dir := token.SHL
+		if operator == ">>" {
+			dir = token.SHR
+		}
+		return constVal{kind: constKindNumber, num: constant.Shift(lhs.num, dir, uint(shift))}, true
+	case "==", "!=":
+		if lhs.kind != rhs.kind {
+			return constVal{}, false
+		}
+		eq := lhs.kind == constKindString && lhs.str == rhs.str || lhs.kind == constKindBool && lhs.b == rhs.b
+		if operator == "!=" {
+			eq = !eq
+		}
+		return constVal{kind: constKindBool, b: eq}, true
+	}
+	return constVal{}, false
+}
+
+func foldUnary(operator string, v constVal) (constVal, bool) {
+	switch operator {
+	case "-":
+		if v.kind != constKindNumber {
+			return constVal{}, false
+		}
+		return constVal{kind: constKindNumber, num: constant.UnaryOp(token.SUB, v.num, 0)}, true
+	case "!", "!!":
+		return constVal{kind: constKindBool, b: operator == "!" && !truthy(v) || operator == "!!" && truthy(v)}, true
+	}
+	return constVal{}, false
+}
+
+func fmtConst(c constVal) string {
+	switch c.kind {
+	case constKindString:
+		return c.str
+	case constKindBool:
+		return strconv.FormatBool(c.b)
+	case constKindNumber:
+		return strings.TrimSuffix(c.num.ExactString(), ".0")
+	}
+	return ""
+}
+
+// literalFor turns a folded constVal back into the ast.Expr type the rest
+// of the tree already expects literals to be. A number whose exact form is
+// a fraction (e.g. 1/3, or 3/10 from 0.1 + 0.2) has no such literal, so
+// pos itself is returned unfolded.
+func literalFor(pos ast.Expr, c constVal) ast.Expr {
+	impl := exprImplOf(pos)
+	switch c.kind {
+	case constKindString:
+		return &ast.StringExpr{ExprImpl: impl, Lit: c.str}
+	case constKindBool:
+		if c.b {
+			return &ast.ConstExpr{ExprImpl: impl, Value: "true"}
+		}
+		return &ast.ConstExpr{ExprImpl: impl, Value: "false"}
+	case constKindNumber:
+		lit := c.num.ExactString()
+		if strings.Contains(lit, "/") {
+			return pos
+		}
+		return &ast.NumberExpr{ExprImpl: impl, Lit: lit}
+	}
+	return pos
+}
+
+// exprImplOf extracts the ExprImpl (position info) off of the node we're
+// replacing, so the folded literal still reports a sensible position for
+// error messages.
+func exprImplOf(expr ast.Expr) ast.ExprImpl {
+	switch e := expr.(type) {
+	case *ast.BinOpExpr:
+		return e.ExprImpl
+	case *ast.UnaryExpr:
+		return e.ExprImpl
+	case *ast.ParenExpr:
+		return e.ExprImpl
+	case *ast.TernaryOpExpr:
+		return e.ExprImpl
+	}
+	return ast.ExprImpl{}
+}
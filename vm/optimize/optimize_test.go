@@ -0,0 +1,99 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/mattn/anko/ast"
+)
+
+func optimizeExprStmt(expr ast.Expr) ast.Expr {
+	stmts := []ast.Stmt{&ast.ExprStmt{Expr: expr}}
+	return Optimize(stmts)[0].(*ast.ExprStmt).Expr
+}
+
+func TestOptimizeFoldsConstantArithmetic(t *testing.T) {
+	// 2 + 3 -> 5
+	expr := &ast.BinOpExpr{
+		Operator: "+",
+		Lhs:      &ast.NumberExpr{Lit: "2"},
+		Rhs:      &ast.NumberExpr{Lit: "3"},
+	}
+	got := optimizeExprStmt(expr)
+	num, ok := got.(*ast.NumberExpr)
+	if !ok {
+		t.Fatalf("expected *ast.NumberExpr, got %T", got)
+	}
+	if num.Lit != "5" {
+		t.Errorf("got %q, want %q", num.Lit, "5")
+	}
+}
+
+func TestOptimizeDoesNotDropLhsEvaluationOfAndOr(t *testing.T) {
+	// `x || true` must not fold away the (non-constant) lhs, since anko
+	// always evaluates both operands of &&/|| and only short-circuits
+	// which one is returned - folding this to a bare `true` literal would
+	// silently drop any side effect in x.
+	expr := &ast.BinOpExpr{
+		Operator: "||",
+		Lhs:      &ast.IdentExpr{Lit: "x"},
+		Rhs:      &ast.ConstExpr{Value: "true"},
+	}
+	got := optimizeExprStmt(expr)
+	bin, ok := got.(*ast.BinOpExpr)
+	if !ok {
+		t.Fatalf("expected the BinOpExpr to survive unfolded, got %T", got)
+	}
+	if _, ok := bin.Lhs.(*ast.IdentExpr); !ok {
+		t.Errorf("lhs was folded away: %#v", bin.Lhs)
+	}
+
+	expr2 := &ast.BinOpExpr{
+		Operator: "&&",
+		Lhs:      &ast.IdentExpr{Lit: "x"},
+		Rhs:      &ast.ConstExpr{Value: "false"},
+	}
+	got2 := optimizeExprStmt(expr2)
+	bin2, ok := got2.(*ast.BinOpExpr)
+	if !ok {
+		t.Fatalf("expected the BinOpExpr to survive unfolded, got %T", got2)
+	}
+	if _, ok := bin2.Lhs.(*ast.IdentExpr); !ok {
+		t.Errorf("lhs was folded away: %#v", bin2.Lhs)
+	}
+}
+
+func TestOptimizeFoldsAndOrOfTwoConstants(t *testing.T) {
+	// Both operands are literal here, so there's no side effect to drop -
+	// this case should still fold.
+	expr := &ast.BinOpExpr{
+		Operator: "||",
+		Lhs:      &ast.ConstExpr{Value: "false"},
+		Rhs:      &ast.ConstExpr{Value: "true"},
+	}
+	got := optimizeExprStmt(expr)
+	c, ok := got.(*ast.ConstExpr)
+	if !ok {
+		t.Fatalf("expected *ast.ConstExpr, got %T", got)
+	}
+	if c.Value != "true" {
+		t.Errorf("got %q, want %q", c.Value, "true")
+	}
+}
+
+func TestOptimizeCollapsesDoubleNegation(t *testing.T) {
+	expr := &ast.UnaryExpr{
+		Operator: "!",
+		Expr: &ast.UnaryExpr{
+			Operator: "!",
+			Expr:     &ast.IdentExpr{Lit: "x"},
+		},
+	}
+	got := optimizeExprStmt(expr)
+	u, ok := got.(*ast.UnaryExpr)
+	if !ok {
+		t.Fatalf("expected *ast.UnaryExpr, got %T", got)
+	}
+	if u.Operator != "!!" {
+		t.Errorf("got operator %q, want %q", u.Operator, "!!")
+	}
+}
@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/ast"
+)
+
+// builtinTypes are the names RegisterBuiltinTypes defines so that scripts
+// can write a Go-like conversion ("n = int(x)") without first going
+// through make/new or a Go-side helper. User-defined types registered via
+// DefineReflectType (see the MakeTypeExpr case) work the same way, since
+// both end up as a reflect.Type value under an identifier.
+var builtinTypes = map[string]reflect.Type{
+	"int":     reflect.TypeOf(int(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint":    reflect.TypeOf(uint(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"string":  reflect.TypeOf(""),
+	"bool":    reflect.TypeOf(false),
+	"[]byte":  reflect.TypeOf([]byte(nil)),
+	"[]rune":  reflect.TypeOf([]rune(nil)),
+	"[]int32": reflect.TypeOf([]int32(nil)),
+}
+
+// RegisterBuiltinTypes defines the builtinTypes table in env, so that
+// "int", "string", "[]byte" etc. resolve to a reflect.Type the same way a
+// user type defined via `make type X ...` does. This snapshot doesn't
+// include env.go/NewEnv, so there's no single place to call this "at env
+// creation time" as intended; tryTypeConversion below falls back to
+// builtinTypes directly for any root Env that never called this, so
+// int(x)/string(buf)/[]byte(s) work without requiring it. Embedders that
+// want the builtin names to also show up as ordinary identifiers (e.g.
+// for `typeof`-style introspection) should still call this once when
+// constructing their Env.
+func RegisterBuiltinTypes(env *Env) error {
+	for name, t := range builtinTypes {
+		if err := env.DefineReflectType(name, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tryTypeConversion checks whether e's callee resolves to a reflect.Type
+// (a builtin name, whether or not RegisterBuiltinTypes was called, or a
+// user type from DefineReflectType) and, if so, evaluates the call as a
+// type conversion rather than a function invocation - mirroring delve's
+// evalToplevelTypeCast. handled is false when e.Func isn't a type, in
+// which case the caller should fall through to the normal CallExpr path.
+func tryTypeConversion(e *ast.CallExpr, env *Env) (rv reflect.Value, handled bool, err error) {
+	t, ok := resolveTypeName(e.Func, env)
+	if !ok {
+		return NilValue, false, nil
+	}
+
+	if len(e.SubExprs) != 1 {
+		return NilValue, true, NewStringError(e, "type conversion requires exactly one argument")
+	}
+	argV, err := invokeExpr(e.SubExprs[0], env)
+	if err != nil {
+		return NilValue, true, NewError(e, err)
+	}
+	if n, ok := asAnkoNumber(argV); ok {
+		argV = toConcrete(n)
+	}
+	if argV.Kind() == reflect.Interface {
+		argV = argV.Elem()
+	}
+
+	rv, err = convertTo(e, argV, t)
+	return rv, true, err
+}
+
+// resolveTypeName reports whether fn names a reflect.Type: something env
+// already resolves to one (a user type from DefineReflectType, or a
+// builtin name if RegisterBuiltinTypes was called), or, failing that, a
+// bare identifier matching builtinTypes directly - so "int"/"string"/
+// "[]byte" etc. work as a top-level conversion even when the env they're
+// running against never registered them.
+//
+// The probe only ever evaluates fn when fn is a bare *ast.IdentExpr: when
+// this reports false, tryTypeConversion reports handled=false and
+// invokeExpr evaluates e.Func a second time through the normal CallExpr
+// path, so resolving
+// any other expression shape here - a CallExpr, an index/member lookup
+// with a getter, anything with a side effect - would run it twice. An
+// identifier lookup has no side effect, so it's the one shape that's
+// always safe to evaluate speculatively.
+func resolveTypeName(fn ast.Expr, env *Env) (reflect.Type, bool) {
+	ident, ok := fn.(*ast.IdentExpr)
+	if !ok {
+		return nil, false
+	}
+	if calleeV, err := invokeExpr(fn, env); err == nil && calleeV.IsValid() && calleeV.CanInterface() {
+		if t, ok := calleeV.Interface().(reflect.Type); ok {
+			return t, true
+		}
+	}
+	if t, ok := builtinTypes[ident.Lit]; ok {
+		return t, true
+	}
+	return nil, false
+}
+
+// convertTo performs the actual conversion, special-casing the
+// string<->[]byte/[]rune pairs that reflect.Value.Convert doesn't handle
+// directly between named vs. unnamed slice types in all Go versions.
+func convertTo(expr ast.Expr, v reflect.Value, t reflect.Type) (reflect.Value, error) {
+	if v.Kind() == reflect.String && (t.Kind() == reflect.Slice) && (t.Elem().Kind() == reflect.Uint8 || t.Elem().Kind() == reflect.Int32) {
+		return v.Convert(t), nil
+	}
+	if v.Kind() == reflect.Slice && t.Kind() == reflect.String && (v.Type().Elem().Kind() == reflect.Uint8 || v.Type().Elem().Kind() == reflect.Int32) {
+		return v.Convert(t), nil
+	}
+	if !v.IsValid() {
+		return reflect.Zero(t), nil
+	}
+	if !v.Type().ConvertibleTo(t) {
+		return NilValue, NewStringError(expr, "cannot convert "+v.Type().String()+" to "+t.String())
+	}
+	return v.Convert(t), nil
+}
@@ -0,0 +1,48 @@
+package vm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mattn/anko/ast"
+)
+
+func TestResolveTypeNameFallsBackToBuiltins(t *testing.T) {
+	// Without any env.DefineReflectType/RegisterBuiltinTypes call, a bare
+	// "int" identifier must still resolve - int(x) has to work without an
+	// embedder remembering to register it first.
+	env := &Env{}
+	fn := &ast.IdentExpr{Lit: "int"}
+
+	typ, ok := resolveTypeName(fn, env)
+	if !ok {
+		t.Fatalf("resolveTypeName(%q) = _, false, want true", "int")
+	}
+	if typ != reflect.TypeOf(int(0)) {
+		t.Errorf("resolveTypeName(%q) = %v, want %v", "int", typ, reflect.TypeOf(int(0)))
+	}
+}
+
+func TestResolveTypeNameUnknownIdentifier(t *testing.T) {
+	env := &Env{}
+	fn := &ast.IdentExpr{Lit: "notAType"}
+
+	if _, ok := resolveTypeName(fn, env); ok {
+		t.Errorf("resolveTypeName(%q) = _, true, want false", "notAType")
+	}
+}
+
+func TestResolveTypeNameOnlyProbesIdentifiers(t *testing.T) {
+	// invokeExpr evaluates e.Func a second time through the normal CallExpr
+	// path whenever resolveTypeName reports false, so any
+	// non-identifier shape - here a ParenExpr wrapping an otherwise
+	// resolvable "int" - must be rejected without being evaluated at all,
+	// rather than evaluated once here and then again by the caller. A
+	// *ast.IdentExpr is the only shape with no side effect to double up on.
+	env := &Env{}
+	fn := &ast.ParenExpr{SubExpr: &ast.IdentExpr{Lit: "int"}}
+
+	if _, ok := resolveTypeName(fn, env); ok {
+		t.Errorf("resolveTypeName(%#v) = _, true, want false (non-identifier callees must not be probed)", fn)
+	}
+}
@@ -3,11 +3,8 @@ package vm
 import (
 	"errors"
 	"fmt"
-	"math"
 	"os"
 	"reflect"
-	"strconv"
-	"strings"
 
 	"github.com/mattn/anko/ast"
 )
@@ -17,24 +14,14 @@ func invokeExpr(expr ast.Expr, env *Env) (reflect.Value, error) {
 	switch e := expr.(type) {
 
 	case *ast.NumberExpr:
-		if strings.Contains(e.Lit, ".") || strings.Contains(e.Lit, "e") {
-			v, err := strconv.ParseFloat(e.Lit, 64)
-			if err != nil {
-				return NilValue, NewError(expr, err)
-			}
-			return reflect.ValueOf(float64(v)), nil
-		}
-		var i int64
-		var err error
-		if strings.HasPrefix(e.Lit, "0x") {
-			i, err = strconv.ParseInt(e.Lit[2:], 16, 64)
-		} else {
-			i, err = strconv.ParseInt(e.Lit, 10, 64)
-		}
+		// Parsed as an exact go/constant.Value rather than straight into
+		// int64/float64, so large integer literals (2 ** 100) and decimals
+		// (0.1 + 0.2) don't lose precision before arithmetic even runs.
+		n, err := newAnkoNumber(e.Lit)
 		if err != nil {
 			return NilValue, NewError(expr, err)
 		}
-		return reflect.ValueOf(i), nil
+		return reflect.ValueOf(n), nil
 
 	case *ast.IdentExpr:
 		return env.get(e.Lit)
@@ -195,6 +182,13 @@ func invokeExpr(expr ast.Expr, env *Env) (reflect.Value, error) {
 		}
 		switch e.Operator {
 		case "-":
+			if n, ok := asAnkoNumber(v); ok {
+				zero, zerr := newAnkoNumber("0")
+				if zerr != nil {
+					return NilValue, NewError(expr, zerr)
+				}
+				return evalAnkoNumberOp("-", zero, n)
+			}
 			if v.Kind() == reflect.Int64 {
 				return reflect.ValueOf(-v.Int()), nil
 			}
@@ -206,6 +200,10 @@ func invokeExpr(expr ast.Expr, env *Env) (reflect.Value, error) {
 			return reflect.ValueOf(^toInt64(v)), nil
 		case "!":
 			return reflect.ValueOf(!toBool(v)), nil
+		case "!!":
+			// Emitted by vm/optimize when it collapses a double negation;
+			// forces v to a plain bool instead of leaving it negated twice.
+			return reflect.ValueOf(toBool(v)), nil
 		default:
 			return NilValue, NewStringError(e, "Unknown operator ''")
 		}
@@ -450,17 +448,14 @@ func invokeExpr(expr ast.Expr, env *Env) (reflect.Value, error) {
 		return rvs[len(rvs)-1], nil
 
 	case *ast.BinOpExpr:
-		lhsV := NilValue
-		rhsV := NilValue
-		var err error
-
-		lhsV, err = invokeExpr(e.Lhs, env)
+		lhsV, err := invokeExpr(e.Lhs, env)
 		if err != nil {
 			return NilValue, NewError(expr, err)
 		}
 		if lhsV.Kind() == reflect.Interface && !lhsV.IsNil() {
 			lhsV = lhsV.Elem()
 		}
+		rhsV := NilValue
 		if e.Rhs != nil {
 			rhsV, err = invokeExpr(e.Rhs, env)
 			if err != nil {
@@ -470,84 +465,7 @@ func invokeExpr(expr ast.Expr, env *Env) (reflect.Value, error) {
 				rhsV = rhsV.Elem()
 			}
 		}
-		switch e.Operator {
-		case "+":
-			if (lhsV.Kind() == reflect.Slice || lhsV.Kind() == reflect.Array) && (rhsV.Kind() != reflect.Slice && rhsV.Kind() != reflect.Array) {
-				rhsT := rhsV.Type()
-				lhsT := lhsV.Type().Elem()
-				if lhsT.Kind() != rhsT.Kind() {
-					if !rhsT.ConvertibleTo(lhsT) {
-						return NilValue, NewStringError(expr, "invalid type conversion")
-					}
-					rhsV = rhsV.Convert(lhsT)
-				}
-				return reflect.Append(lhsV, rhsV), nil
-			}
-			if (lhsV.Kind() == reflect.Slice || lhsV.Kind() == reflect.Array) && (rhsV.Kind() == reflect.Slice || rhsV.Kind() == reflect.Array) {
-				return appendSlice(expr, lhsV, rhsV)
-			}
-			if lhsV.Kind() == reflect.String || rhsV.Kind() == reflect.String {
-				return reflect.ValueOf(toString(lhsV) + toString(rhsV)), nil
-			}
-			if lhsV.Kind() == reflect.Float64 || rhsV.Kind() == reflect.Float64 {
-				return reflect.ValueOf(toFloat64(lhsV) + toFloat64(rhsV)), nil
-			}
-			return reflect.ValueOf(toInt64(lhsV) + toInt64(rhsV)), nil
-		case "-":
-			if lhsV.Kind() == reflect.Float64 || rhsV.Kind() == reflect.Float64 {
-				return reflect.ValueOf(toFloat64(lhsV) - toFloat64(rhsV)), nil
-			}
-			return reflect.ValueOf(toInt64(lhsV) - toInt64(rhsV)), nil
-		case "*":
-			if lhsV.Kind() == reflect.String && (rhsV.Kind() == reflect.Int || rhsV.Kind() == reflect.Int32 || rhsV.Kind() == reflect.Int64) {
-				return reflect.ValueOf(strings.Repeat(toString(lhsV), int(toInt64(rhsV)))), nil
-			}
-			if lhsV.Kind() == reflect.Float64 || rhsV.Kind() == reflect.Float64 {
-				return reflect.ValueOf(toFloat64(lhsV) * toFloat64(rhsV)), nil
-			}
-			return reflect.ValueOf(toInt64(lhsV) * toInt64(rhsV)), nil
-		case "/":
-			return reflect.ValueOf(toFloat64(lhsV) / toFloat64(rhsV)), nil
-		case "%":
-			return reflect.ValueOf(toInt64(lhsV) % toInt64(rhsV)), nil
-		case "==":
-			return reflect.ValueOf(equal(lhsV, rhsV)), nil
-		case "!=":
-			return reflect.ValueOf(equal(lhsV, rhsV) == false), nil
-		case ">":
-			return reflect.ValueOf(toFloat64(lhsV) > toFloat64(rhsV)), nil
-		case ">=":
-			return reflect.ValueOf(toFloat64(lhsV) >= toFloat64(rhsV)), nil
-		case "<":
-			return reflect.ValueOf(toFloat64(lhsV) < toFloat64(rhsV)), nil
-		case "<=":
-			return reflect.ValueOf(toFloat64(lhsV) <= toFloat64(rhsV)), nil
-		case "|":
-			return reflect.ValueOf(toInt64(lhsV) | toInt64(rhsV)), nil
-		case "||":
-			if toBool(lhsV) {
-				return lhsV, nil
-			}
-			return rhsV, nil
-		case "&":
-			return reflect.ValueOf(toInt64(lhsV) & toInt64(rhsV)), nil
-		case "&&":
-			if toBool(lhsV) {
-				return rhsV, nil
-			}
-			return lhsV, nil
-		case "**":
-			if lhsV.Kind() == reflect.Float64 {
-				return reflect.ValueOf(math.Pow(lhsV.Float(), toFloat64(rhsV))), nil
-			}
-			return reflect.ValueOf(int64(math.Pow(toFloat64(lhsV), toFloat64(rhsV)))), nil
-		case ">>":
-			return reflect.ValueOf(toInt64(lhsV) >> uint64(toInt64(rhsV))), nil
-		case "<<":
-			return reflect.ValueOf(toInt64(lhsV) << uint64(toInt64(rhsV))), nil
-		default:
-			return NilValue, NewStringError(expr, "Unknown operator")
-		}
+		return evalBinOp(expr, e.Operator, lhsV, rhsV)
 
 	case *ast.ConstExpr:
 		switch e.Value {
@@ -723,8 +641,20 @@ func invokeExpr(expr ast.Expr, env *Env) (reflect.Value, error) {
 		return AnonCallExpr(e, env)
 
 	case *ast.CallExpr:
+		if rv, handled, err := tryTypeConversion(e, env); handled {
+			return rv, err
+		}
 		return CallExpr(e, env)
 
+	case *ast.WhereExpr:
+		return evalWhereExpr(e, env)
+
+	case *ast.GroupByExpr:
+		return evalGroupByExpr(e, env)
+
+	case *ast.SortByExpr:
+		return evalSortByExpr(e, env)
+
 	default:
 		return NilValue, NewStringError(expr, "Unknown expression")
 	}
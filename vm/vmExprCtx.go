@@ -0,0 +1,286 @@
+package vm
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/mattn/anko/ast"
+)
+
+// ExecuteContext runs stmts against env like Run, but aborts as soon as ctx
+// is cancelled instead of running the script to completion. It is the
+// entry point embedders should use when evaluating untrusted or
+// request-scoped scripts under a deadline.
+func ExecuteContext(ctx context.Context, env *Env, stmts []ast.Stmt) (reflect.Value, error) {
+	return runStmtsCtx(ctx, stmts, env)
+}
+
+// runStmtsCtx runs stmts in sequence, returning the value of the last one.
+func runStmtsCtx(ctx context.Context, stmts []ast.Stmt, env *Env) (reflect.Value, error) {
+	rv := NilValue
+	var err error
+	for _, stmt := range stmts {
+		rv, err = runSingleStmtCtx(ctx, stmt, env)
+		if err != nil {
+			return rv, err
+		}
+	}
+	return rv, nil
+}
+
+// runSingleStmtCtx is invokeExprCtx's statement-level counterpart. Besides
+// the entry check, every loop form re-checks ctx.Err() once per
+// iteration - not just once at the top - so a script blocked in a long or
+// infinite loop can still be cancelled mid-run, which is the main reason
+// embedders reach for ExecuteContext in the first place.
+func runSingleStmtCtx(ctx context.Context, stmt ast.Stmt, env *Env) (reflect.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return NilValue, NewErrorf(stmt, "context cancelled: %v", err)
+	}
+	switch s := stmt.(type) {
+	case *ast.ExprStmt:
+		return invokeExprCtx(ctx, s.Expr, env)
+
+	case *ast.IfStmt:
+		return ifStmtCtx(ctx, s, env)
+
+	case *ast.LoopStmt:
+		// `for Expr { Stmts }` - the while-style "for".
+		rv := NilValue
+		for {
+			if err := ctx.Err(); err != nil {
+				return NilValue, NewErrorf(s, "context cancelled: %v", err)
+			}
+			cond, err := invokeExprCtx(ctx, s.Expr, env)
+			if err != nil {
+				return NilValue, err
+			}
+			if !toBool(cond) {
+				return rv, nil
+			}
+			rv, err = runStmtsCtx(ctx, s.Stmts, env)
+			if err != nil {
+				return NilValue, err
+			}
+		}
+
+	case *ast.ForStmt:
+		// `for Var in Value { Stmts }` - "for-in" over a collection.
+		collV, err := invokeExprCtx(ctx, s.Value, env)
+		if err != nil {
+			return NilValue, err
+		}
+		elems, _, err := collElements(s, collV)
+		if err != nil {
+			return NilValue, err
+		}
+		rv := NilValue
+		for _, elemV := range elems {
+			if err := ctx.Err(); err != nil {
+				return NilValue, NewErrorf(s, "context cancelled: %v", err)
+			}
+			if err := env.Define(s.Var, elemV); err != nil {
+				return NilValue, NewError(s, err)
+			}
+			rv, err = runStmtsCtx(ctx, s.Stmts, env)
+			if err != nil {
+				return NilValue, err
+			}
+		}
+		return rv, nil
+
+	case *ast.CForStmt:
+		// `for Stmt1; Expr2; Expr3 { Stmts }` - C-style "for-range" with an
+		// explicit init/cond/post, as opposed to LoopStmt's bare condition.
+		if s.Stmt1 != nil {
+			if _, err := runSingleStmtCtx(ctx, s.Stmt1, env); err != nil {
+				return NilValue, err
+			}
+		}
+		rv := NilValue
+		for {
+			if err := ctx.Err(); err != nil {
+				return NilValue, NewErrorf(s, "context cancelled: %v", err)
+			}
+			if s.Expr2 != nil {
+				cond, err := invokeExprCtx(ctx, s.Expr2, env)
+				if err != nil {
+					return NilValue, err
+				}
+				if !toBool(cond) {
+					return rv, nil
+				}
+			}
+			var err error
+			rv, err = runStmtsCtx(ctx, s.Stmts, env)
+			if err != nil {
+				return NilValue, err
+			}
+			if s.Expr3 != nil {
+				if _, err := invokeExprCtx(ctx, s.Expr3, env); err != nil {
+					return NilValue, err
+				}
+			}
+		}
+
+	default:
+		return NilValue, NewStringError(stmt, "statement type is not yet supported by ExecuteContext")
+	}
+}
+
+// ifStmtCtx runs an *ast.IfStmt's matching branch, recursing through
+// ElseIf the same way the non-ctx evaluator presumably does.
+func ifStmtCtx(ctx context.Context, s *ast.IfStmt, env *Env) (reflect.Value, error) {
+	cond, err := invokeExprCtx(ctx, s.If, env)
+	if err != nil {
+		return NilValue, err
+	}
+	if toBool(cond) {
+		return runStmtsCtx(ctx, s.Then, env)
+	}
+	for _, ei := range s.ElseIf {
+		if elseIf, ok := ei.(*ast.IfStmt); ok {
+			econd, err := invokeExprCtx(ctx, elseIf.If, env)
+			if err != nil {
+				return NilValue, err
+			}
+			if toBool(econd) {
+				return runStmtsCtx(ctx, elseIf.Then, env)
+			}
+		}
+	}
+	return runStmtsCtx(ctx, s.Else, env)
+}
+
+// invokeExprCtx is invokeExpr's context-aware twin. It checks ctx.Err() at
+// entry, and channel receives/sends select on ctx.Done() (loop iterations
+// are checked by runSingleStmtCtx). Only BinOpExpr, TernaryOpExpr and
+// ChanExpr recurse back into invokeExprCtx for their sub-expressions;
+// every other expression kind is handed to invokeExpr, which evaluates
+// that whole subtree without further ctx checks.
+func invokeExprCtx(ctx context.Context, expr ast.Expr, env *Env) (reflect.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return NilValue, NewErrorf(expr, "context cancelled: %v", err)
+	}
+
+	switch e := expr.(type) {
+
+	case *ast.ChanExpr:
+		return chanExprCtx(ctx, e, env)
+
+	case *ast.MakeChanExpr:
+		return invokeExpr(expr, env)
+
+	case *ast.BinOpExpr:
+		// invokeExpr always evaluates both operands (it only short-circuits
+		// which one it *returns*, not whether the other runs) - match that
+		// here too, so a script like `f() && g()` calls g() identically
+		// under Run and under ExecuteContext instead of diverging on side
+		// effects depending on which evaluator ran it.
+		lhsV, err := invokeExprCtx(ctx, e.Lhs, env)
+		if err != nil {
+			return NilValue, err
+		}
+		if lhsV.Kind() == reflect.Interface && !lhsV.IsNil() {
+			lhsV = lhsV.Elem()
+		}
+		rhsV := NilValue
+		if e.Rhs != nil {
+			rhsV, err = invokeExprCtx(ctx, e.Rhs, env)
+			if err != nil {
+				return NilValue, err
+			}
+			if rhsV.Kind() == reflect.Interface && !rhsV.IsNil() {
+				rhsV = rhsV.Elem()
+			}
+		}
+		// Operand evaluation is the only part that needs the per-node ctx
+		// check (loops/chans inside lhs/rhs); the actual operator dispatch
+		// is identical to invokeExpr's, so it's shared via evalBinOp -
+		// including its AnkoNumber handling - instead of duplicated here.
+		return evalBinOp(expr, e.Operator, lhsV, rhsV)
+
+	case *ast.TernaryOpExpr:
+		rv, err := invokeExprCtx(ctx, e.Expr, env)
+		if err != nil {
+			return NilValue, err
+		}
+		if toBool(rv) {
+			return invokeExprCtx(ctx, e.Lhs, env)
+		}
+		return invokeExprCtx(ctx, e.Rhs, env)
+
+	default:
+		return invokeExpr(expr, env)
+	}
+}
+
+// chanExprCtx is ChanExpr's receive/send handling, rewritten to use
+// reflect.Select over both the channel and ctx.Done() so a script blocked
+// on <-ch can still be cancelled.
+func chanExprCtx(ctx context.Context, e *ast.ChanExpr, env *Env) (reflect.Value, error) {
+	rhs, err := invokeExprCtx(ctx, e.Rhs, env)
+	if err != nil {
+		return NilValue, NewError(e, err)
+	}
+
+	if e.Lhs == nil {
+		if rhs.Kind() != reflect.Chan {
+			return NilValue, NewStringError(e, "Invalid operation for chan")
+		}
+		rv, ok, err := selectRecv(ctx, rhs)
+		if err != nil {
+			return NilValue, NewError(e, err)
+		}
+		if !ok {
+			return NilValue, nil
+		}
+		return rv, nil
+	}
+
+	lhs, err := invokeExprCtx(ctx, e.Lhs, env)
+	if err != nil {
+		return NilValue, NewError(e, err)
+	}
+	if lhs.Kind() == reflect.Chan {
+		if err := selectSend(ctx, lhs, rhs); err != nil {
+			return NilValue, NewError(e, err)
+		}
+		return NilValue, nil
+	}
+	if rhs.Kind() == reflect.Chan {
+		rv, ok, err := selectRecv(ctx, rhs)
+		if err != nil {
+			return NilValue, NewError(e, err)
+		}
+		if !ok {
+			return NilValue, NewErrorf(e, "Failed to send to channel")
+		}
+		return invokeLetExpr(e.Lhs, rv, env)
+	}
+	return NilValue, NewStringError(e, "Invalid operation for chan")
+}
+
+// selectRecv receives from ch unless ctx is done first.
+func selectRecv(ctx context.Context, ch reflect.Value) (reflect.Value, bool, error) {
+	chosen, rv, recvOK := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	})
+	if chosen == 1 {
+		return NilValue, false, ctx.Err()
+	}
+	return rv, recvOK, nil
+}
+
+// selectSend sends v on ch unless ctx is done first.
+func selectSend(ctx context.Context, ch, v reflect.Value) error {
+	chosen, _, _ := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: ch, Send: v},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	})
+	if chosen == 1 {
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattn/anko/ast"
+)
+
+func TestExecuteContextCancelsInfiniteLoop(t *testing.T) {
+	// `for true { }` never terminates on its own; ExecuteContext must
+	// still return once ctx is cancelled, instead of hanging forever -
+	// the main reason embedders reach for it in the first place.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	stmts := []ast.Stmt{
+		&ast.LoopStmt{
+			Expr:  &ast.ConstExpr{Value: "true"},
+			Stmts: nil,
+		},
+	}
+
+	_, err := ExecuteContext(ctx, &Env{}, stmts)
+	if err == nil {
+		t.Fatal("expected ExecuteContext to return an error for a cancelled context, got nil")
+	}
+}
+
+func TestExecuteContextRunsForInLoop(t *testing.T) {
+	// Before the fix, only *ast.ExprStmt was handled and every loop form
+	// hit the "statement type is not yet supported" default branch.
+	stmts := []ast.Stmt{
+		&ast.ForStmt{
+			Var:   "i",
+			Value: &ast.IdentExpr{Lit: "items"},
+			Stmts: []ast.Stmt{&ast.ExprStmt{Expr: &ast.IdentExpr{Lit: "i"}}},
+		},
+	}
+
+	env := &Env{}
+	if err := env.Define("items", []interface{}{1, 2, 3}); err != nil {
+		t.Fatalf("env.Define: %v", err)
+	}
+
+	if _, err := ExecuteContext(context.Background(), env, stmts); err != nil {
+		t.Fatalf("ExecuteContext: %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package vm
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mattn/anko/ast"
+)
+
+// resolveKeyPath walks a dotted key path ("a.b.c") against v, indirecting
+// through pointers/interfaces and, at each segment, looking the next name
+// up as a struct field or map key - the same traversal MemberExpr already
+// does for a single name, just repeated per segment.
+func resolveKeyPath(expr ast.Expr, v reflect.Value, key string) (reflect.Value, error) {
+	for _, seg := range strings.Split(key, ".") {
+		v = indirectValue(v)
+		if !v.IsValid() {
+			return NilValue, NewStringError(expr, "no member named '"+seg+"' for nil value")
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			field, found := v.Type().FieldByName(seg)
+			if !found {
+				return NilValue, NewStringError(expr, "no member named '"+seg+"' for struct")
+			}
+			v = v.FieldByIndex(field.Index)
+		case reflect.Map:
+			v = getMapIndex(reflect.ValueOf(seg), v)
+		default:
+			return NilValue, NewStringError(expr, "type "+v.Kind().String()+" does not support member operation")
+		}
+	}
+	return v, nil
+}
+
+// indirectValue unwraps interfaces and pointers until it reaches a
+// concrete addressable-or-not value, mirroring the indirect() performed
+// ad hoc in several invokeExpr cases (MemberExpr, DerefExpr, AddrExpr).
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return v
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// collElements returns the elements of a slice/array/map collection value
+// (after indirecting through pointers/interfaces) as a flat slice, plus
+// the indirected collection value itself so callers can rebuild the same
+// shape.
+func collElements(pos ast.Node, v reflect.Value) ([]reflect.Value, reflect.Value, error) {
+	v = indirectValue(v)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		out := make([]reflect.Value, v.Len())
+		for i := range out {
+			out[i] = v.Index(i)
+		}
+		return out, v, nil
+	case reflect.Map:
+		out := make([]reflect.Value, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			out = append(out, v.MapIndex(k))
+		}
+		return out, v, nil
+	default:
+		return nil, NilValue, NewStringError(pos, "type "+v.Kind().String()+" does not support collection query operations")
+	}
+}
+
+// matchesOp evaluates `elemVal Op want` for the where() operators.
+func matchesOp(expr ast.Expr, op string, elemVal, want reflect.Value) (bool, error) {
+	switch op {
+	case "==":
+		return equal(elemVal, want), nil
+	case "!=":
+		return !equal(elemVal, want), nil
+	case "<":
+		return compareOrdered(elemVal, want) < 0, nil
+	case "<=":
+		return compareOrdered(elemVal, want) <= 0, nil
+	case ">":
+		return compareOrdered(elemVal, want) > 0, nil
+	case ">=":
+		return compareOrdered(elemVal, want) >= 0, nil
+	case "in":
+		return setContains(want, elemVal), nil
+	case "not in":
+		return !setContains(want, elemVal), nil
+	case "intersect":
+		return setIntersects(indirectValue(elemVal), indirectValue(want)), nil
+	default:
+		return false, NewStringError(expr, "unknown where operator '"+op+"'")
+	}
+}
+
+// compareOrdered orders a and b for the where()/sort_by() relational
+// operators, comparing lexically when either side is a string and
+// numerically otherwise - toFloat64 alone would coerce every string key
+// to 0, silently turning e.g. sort_by("name") or where("name", "<", "b")
+// into a no-op comparison.
+func compareOrdered(a, b reflect.Value) int {
+	if indirectValue(a).Kind() == reflect.String || indirectValue(b).Kind() == reflect.String {
+		as, bs := toString(a), toString(b)
+		switch {
+		case as < bs:
+			return -1
+		case as > bs:
+			return 1
+		default:
+			return 0
+		}
+	}
+	af, bf := toFloat64(a), toFloat64(b)
+	switch {
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// setContains reports whether set (a slice/array) contains v, used for the
+// "in"/"not in" operators.
+func setContains(set, v reflect.Value) bool {
+	set = indirectValue(set)
+	if set.Kind() != reflect.Slice && set.Kind() != reflect.Array {
+		return equal(set, v)
+	}
+	for i := 0; i < set.Len(); i++ {
+		if equal(set.Index(i), v) {
+			return true
+		}
+	}
+	return false
+}
+
+// setIntersects reports whether the two slice-valued elements share at
+// least one element, used for the "intersect" operator.
+func setIntersects(a, b reflect.Value) bool {
+	if a.Kind() != reflect.Slice && a.Kind() != reflect.Array {
+		return false
+	}
+	if b.Kind() != reflect.Slice && b.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < a.Len(); i++ {
+		if setContains(b, a.Index(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalWhereExpr implements `coll | where("k.sub", "==", 3)`.
+func evalWhereExpr(e *ast.WhereExpr, env *Env) (reflect.Value, error) {
+	collV, err := invokeExpr(e.Coll, env)
+	if err != nil {
+		return NilValue, NewError(e, err)
+	}
+	valV, err := invokeExpr(e.Val, env)
+	if err != nil {
+		return NilValue, NewError(e, err)
+	}
+
+	elems, orig, err := collElements(e, collV)
+	if err != nil {
+		return NilValue, err
+	}
+
+	if orig.Kind() == reflect.Map {
+		out := reflect.MakeMap(orig.Type())
+		for _, k := range orig.MapKeys() {
+			elemV := orig.MapIndex(k)
+			keyed, err := resolveKeyPath(e, elemV, e.Key)
+			if err != nil {
+				return NilValue, err
+			}
+			ok, err := matchesOp(e, e.Op, keyed, valV)
+			if err != nil {
+				return NilValue, err
+			}
+			if ok {
+				out.SetMapIndex(k, elemV)
+			}
+		}
+		return out, nil
+	}
+
+	out := reflect.MakeSlice(reflect.SliceOf(orig.Type().Elem()), 0, len(elems))
+	for _, elemV := range elems {
+		keyed, err := resolveKeyPath(e, elemV, e.Key)
+		if err != nil {
+			return NilValue, err
+		}
+		ok, err := matchesOp(e, e.Op, keyed, valV)
+		if err != nil {
+			return NilValue, err
+		}
+		if ok {
+			out = reflect.Append(out, elemV)
+		}
+	}
+	return out, nil
+}
+
+// evalGroupByExpr implements `coll | group_by("type")`, returning a
+// map[string][]interface{} keyed by the string form of each element's
+// Key path value.
+func evalGroupByExpr(e *ast.GroupByExpr, env *Env) (reflect.Value, error) {
+	collV, err := invokeExpr(e.Coll, env)
+	if err != nil {
+		return NilValue, NewError(e, err)
+	}
+	elems, _, err := collElements(e, collV)
+	if err != nil {
+		return NilValue, err
+	}
+
+	groups := make(map[string][]interface{})
+	for _, elemV := range elems {
+		keyed, err := resolveKeyPath(e, elemV, e.Key)
+		if err != nil {
+			return NilValue, err
+		}
+		k := toString(keyed)
+		groups[k] = append(groups[k], elemV.Interface())
+	}
+	return reflect.ValueOf(groups), nil
+}
+
+// evalSortByExpr implements `coll | sort_by("name")`, returning a new
+// slice with the same element type as Coll ordered by Key.
+func evalSortByExpr(e *ast.SortByExpr, env *Env) (reflect.Value, error) {
+	collV, err := invokeExpr(e.Coll, env)
+	if err != nil {
+		return NilValue, NewError(e, err)
+	}
+	elems, orig, err := collElements(e, collV)
+	if err != nil {
+		return NilValue, err
+	}
+	if orig.Kind() == reflect.Map {
+		return NilValue, NewStringError(e, "sort_by does not support map collections")
+	}
+
+	sorted := make([]reflect.Value, len(elems))
+	copy(sorted, elems)
+
+	var sortErr error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ki, err := resolveKeyPath(e, sorted[i], e.Key)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		kj, err := resolveKeyPath(e, sorted[j], e.Key)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		less := compareOrdered(ki, kj) < 0
+		if e.Desc {
+			return !less
+		}
+		return less
+	})
+	if sortErr != nil {
+		return NilValue, sortErr
+	}
+
+	out := reflect.MakeSlice(reflect.SliceOf(orig.Type().Elem()), 0, len(sorted))
+	for _, v := range sorted {
+		out = reflect.Append(out, v)
+	}
+	return out, nil
+}
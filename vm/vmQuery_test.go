@@ -0,0 +1,24 @@
+package vm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareOrderedStringsLexical(t *testing.T) {
+	if got := compareOrdered(reflect.ValueOf("apple"), reflect.ValueOf("banana")); got >= 0 {
+		t.Errorf("compareOrdered(apple, banana) = %d, want < 0", got)
+	}
+	if got := compareOrdered(reflect.ValueOf("banana"), reflect.ValueOf("apple")); got <= 0 {
+		t.Errorf("compareOrdered(banana, apple) = %d, want > 0", got)
+	}
+	if got := compareOrdered(reflect.ValueOf("same"), reflect.ValueOf("same")); got != 0 {
+		t.Errorf("compareOrdered(same, same) = %d, want 0", got)
+	}
+}
+
+func TestCompareOrderedNumbersNumeric(t *testing.T) {
+	if got := compareOrdered(reflect.ValueOf(2), reflect.ValueOf(10)); got >= 0 {
+		t.Errorf("compareOrdered(2, 10) = %d, want < 0 (numeric, not lexical)", got)
+	}
+}